@@ -4,15 +4,23 @@ import (
 	"context"
 	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/aws/aws-sdk-go/service/sts"
 	"github.com/integr8ly/cloud-resource-operator/pkg/resources"
 	"github.com/sirupsen/logrus"
-	"reflect"
+	corev1 "k8s.io/api/core/v1"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"os"
 	"regexp"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sort"
+	"strings"
+	"sync"
 
-	"k8s.io/apimachinery/pkg/util/wait"
 	"time"
 
 	errorUtil "github.com/pkg/errors"
@@ -21,30 +29,442 @@ import (
 const (
 	defaultSubnetPostfix        = "subnet-group"
 	defaultSecurityGroupPostfix = "security-group"
+	discoveryConfigMapName      = "cloud-resource-config"
 )
 
-// ensures a subnet group is in place for the creation of a resource
-func SetupSecurityGroup(ctx context.Context, c client.Client, ec2Svc ec2iface.EC2API) error {
+// AwsNetworkConfig holds user-supplied network identifiers that let a caller
+// bring their own VPC, subnets and security groups instead of relying on
+// CRO's cluster-tag based auto-discovery. It is built from a set of
+// CloudOption functions and is zero-value safe; unset fields fall back to
+// the existing discovery behaviour.
+type AwsNetworkConfig struct {
+	VPCID                     string
+	PrivateSubnetIDs          []string
+	SecurityGroupID           string
+	ControlPlaneSecurityGroup string
+	SecurityGroupRules        []SecurityGroupRule
+}
+
+// ResourceType identifies the kind of cloud resource a security group is
+// being reconciled for, so SetupSecurityGroup only opens the ports that
+// resource actually needs instead of allowing all protocols.
+type ResourceType string
+
+const (
+	ResourceTypePostgres    ResourceType = "postgres"
+	ResourceTypeRedis       ResourceType = "redis"
+	ResourceTypeElasticache ResourceType = "elasticache"
+)
+
+// SecurityGroupRule describes a single desired ingress rule for a resource's
+// security group. CIDRBlocks and SourceSecurityGroupID are alternative ways
+// of specifying the rule's peer; if neither is set, the rule falls back to
+// the cluster CIDR (or the control plane security group, if supplied).
+type SecurityGroupRule struct {
+	Protocol              string
+	FromPort              int64
+	ToPort                int64
+	CIDRBlocks            []string
+	SourceSecurityGroupID string
+	Description           string
+}
+
+// defaultSecurityGroupRules maps a ResourceType to the ports it requires,
+// used when the CR spec does not supply an explicit rule set.
+var defaultSecurityGroupRules = map[ResourceType][]SecurityGroupRule{
+	ResourceTypePostgres: {
+		{Protocol: "tcp", FromPort: 5432, ToPort: 5432, Description: "allow access to postgres"},
+	},
+	ResourceTypeRedis: {
+		{Protocol: "tcp", FromPort: 6379, ToPort: 6379, Description: "allow access to redis"},
+	},
+	ResourceTypeElasticache: {
+		{Protocol: "tcp", FromPort: 6379, ToPort: 6379, Description: "allow access to elasticache"},
+	},
+}
+
+// CloudOption configures an AwsNetworkConfig, allowing callers to supply
+// pre-existing AWS infrastructure for installs onto customer-owned VPCs
+// where CRO does not own the network.
+type CloudOption func(*AwsNetworkConfig)
+
+// WithVPCID configures an existing VPC ID to use instead of discovering the
+// cluster VPC via the `<clusterID>-vpc` tag.
+func WithVPCID(id string) CloudOption {
+	return func(cfg *AwsNetworkConfig) {
+		cfg.VPCID = id
+	}
+}
+
+// WithPrivateSubnetIDs configures an explicit set of private subnet IDs to
+// use instead of discovering subnets by tag.
+func WithPrivateSubnetIDs(ids []string) CloudOption {
+	return func(cfg *AwsNetworkConfig) {
+		cfg.PrivateSubnetIDs = ids
+	}
+}
+
+// WithSecurityGroupID configures an existing security group ID to reuse
+// instead of creating a security group named after the cluster.
+func WithSecurityGroupID(id string) CloudOption {
+	return func(cfg *AwsNetworkConfig) {
+		cfg.SecurityGroupID = id
+	}
+}
+
+// WithControlPlaneSecurityGroup configures the ID of the cluster's control
+// plane security group, used as a peer when authorizing ingress instead of
+// a CIDR range.
+func WithControlPlaneSecurityGroup(id string) CloudOption {
+	return func(cfg *AwsNetworkConfig) {
+		cfg.ControlPlaneSecurityGroup = id
+	}
+}
+
+// WithSecurityGroupRules overrides the default ResourceType ingress rules
+// with an explicit rule set, typically sourced from the CR spec.
+func WithSecurityGroupRules(rules []SecurityGroupRule) CloudOption {
+	return func(cfg *AwsNetworkConfig) {
+		cfg.SecurityGroupRules = rules
+	}
+}
+
+// buildNetworkConfig applies a set of CloudOption functions and returns the
+// resulting AwsNetworkConfig.
+func buildNetworkConfig(opts ...CloudOption) *AwsNetworkConfig {
+	cfg := &AwsNetworkConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// DiscoveryConfig controls the tag keys/values CRO uses to auto-discover the
+// cluster VPC and its private subnets. It defaults to the OpenShift
+// installer's conventions but can be overridden via the cloud-resource-config
+// ConfigMap so CRO also works on clusters installed by kOps, CAPA or custom
+// Terraform, whose VPCs use different tagging conventions.
+type DiscoveryConfig struct {
+	VPCTagKey             string
+	VPCTagValue           string
+	PrivateSubnetTagKey   string
+	PrivateSubnetTagValue string
+}
+
+// defaultDiscoveryConfig returns the OpenShift installer tagging convention:
+// a vpc with a tag valued `<clusterID>-vpc` (under any key, matching the
+// original behaviour) and subnets whose tags contain "private".
+func defaultDiscoveryConfig(clusterID string) *DiscoveryConfig {
+	return &DiscoveryConfig{
+		VPCTagKey:             "",
+		VPCTagValue:           fmt.Sprintf("%s-vpc", clusterID),
+		PrivateSubnetTagKey:   "",
+		PrivateSubnetTagValue: "\\b(\\w*private\\w*)\\b",
+	}
+}
+
+// loadDiscoveryConfig returns the DiscoveryConfig to use, overriding the
+// installer defaults with any values found in the cloud-resource-config
+// ConfigMap in the operator's watch namespace.
+func loadDiscoveryConfig(ctx context.Context, c client.Client, clusterID string) (*DiscoveryConfig, error) {
+	cfg := defaultDiscoveryConfig(clusterID)
+
+	namespace := os.Getenv("WATCH_NAMESPACE")
+	if namespace == "" {
+		return cfg, nil
+	}
+
+	cm := &corev1.ConfigMap{}
+	if err := c.Get(ctx, types.NamespacedName{Name: discoveryConfigMapName, Namespace: namespace}, cm); err != nil {
+		if k8serr.IsNotFound(err) {
+			return cfg, nil
+		}
+		return nil, errorUtil.Wrap(err, "error getting cloud-resource-config config map")
+	}
+
+	if v, ok := cm.Data["vpcTagKey"]; ok && v != "" {
+		cfg.VPCTagKey = v
+	}
+	if v, ok := cm.Data["vpcTagValue"]; ok && v != "" {
+		cfg.VPCTagValue = v
+	}
+	if v, ok := cm.Data["privateSubnetTagKey"]; ok && v != "" {
+		cfg.PrivateSubnetTagKey = v
+	}
+	if v, ok := cm.Data["privateSubnetTagValue"]; ok && v != "" {
+		cfg.PrivateSubnetTagValue = v
+	}
+
+	return cfg, nil
+}
+
+// NetworkCacheKey identifies the account, region and cluster a set of cached
+// network objects belongs to, so that per-account assumed-role ec2iface.EC2API
+// clients in the same controller-manager process never share cached network
+// objects across accounts.
+type NetworkCacheKey struct {
+	AccountID string
+	Region    string
+	ClusterID string
+}
+
+type networkCacheEntry struct {
+	vpc            *ec2.Vpc
+	subnets        []*ec2.Subnet
+	securityGroups []*ec2.SecurityGroup
+	expiresAt      time.Time
+}
+
+func (e *networkCacheEntry) expired() bool {
+	return time.Now().After(e.expiresAt)
+}
+
+// defaultNetworkCacheTTL bounds how long a NetworkCache entry is trusted
+// before the next reconcile re-fetches it from EC2.
+const defaultNetworkCacheTTL = time.Minute * 5
+
+// NetworkCache memoizes VPC, subnet and security group lookups across
+// reconciles of many Postgres/Redis/BlobStorage CRs on the same cluster, so
+// CRO doesn't hammer the EC2 API on clusters with many CRs. Entries expire
+// after their TTL and are invalidated whenever a mutating EC2 call succeeds.
+// A single NetworkCache is intended to be shared by every provider in a
+// controller-manager process; see networkCache for the package singleton.
+type NetworkCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[NetworkCacheKey]*networkCacheEntry
+}
+
+// NewNetworkCache returns an empty NetworkCache whose entries expire after ttl.
+func NewNetworkCache(ttl time.Duration) *NetworkCache {
+	return &NetworkCache{
+		ttl:     ttl,
+		entries: make(map[NetworkCacheKey]*networkCacheEntry),
+	}
+}
+
+// networkCache is the per-controller-manager singleton NetworkCache shared
+// by SetupSecurityGroup, GetVPCSubnets, GetCidr and getVpc/getSecurityGroup.
+var networkCache = NewNetworkCache(defaultNetworkCacheTTL)
+
+// entryLocked returns the entry for key, creating a fresh one if absent or
+// expired. Callers must hold nc.mu for the full duration of their use of the
+// returned entry's fields - the entry itself has no lock of its own.
+func (nc *NetworkCache) entryLocked(key NetworkCacheKey) *networkCacheEntry {
+	e, ok := nc.entries[key]
+	if !ok || e.expired() {
+		e = &networkCacheEntry{expiresAt: time.Now().Add(nc.ttl)}
+		nc.entries[key] = e
+	}
+	return e
+}
+
+func (nc *NetworkCache) GetVPC(key NetworkCacheKey) *ec2.Vpc {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	e, ok := nc.entries[key]
+	if !ok || e.expired() {
+		return nil
+	}
+	return e.vpc
+}
+
+func (nc *NetworkCache) SetVPC(key NetworkCacheKey, vpc *ec2.Vpc) {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	nc.entryLocked(key).vpc = vpc
+}
+
+func (nc *NetworkCache) GetSubnets(key NetworkCacheKey) []*ec2.Subnet {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	e, ok := nc.entries[key]
+	if !ok || e.expired() {
+		return nil
+	}
+	return e.subnets
+}
+
+func (nc *NetworkCache) SetSubnets(key NetworkCacheKey, subnets []*ec2.Subnet) {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	nc.entryLocked(key).subnets = subnets
+}
+
+func (nc *NetworkCache) GetSecurityGroups(key NetworkCacheKey) []*ec2.SecurityGroup {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	e, ok := nc.entries[key]
+	if !ok || e.expired() {
+		return nil
+	}
+	return e.securityGroups
+}
+
+func (nc *NetworkCache) SetSecurityGroups(key NetworkCacheKey, groups []*ec2.SecurityGroup) {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	nc.entryLocked(key).securityGroups = groups
+}
+
+// Invalidate drops the cached entry for key, forcing the next lookup to hit
+// EC2 directly. Called after a mutating call (CreateSecurityGroup,
+// AuthorizeSecurityGroupIngress, RevokeSecurityGroupIngress) succeeds.
+func (nc *NetworkCache) Invalidate(key NetworkCacheKey) {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	delete(nc.entries, key)
+}
+
+// accountIDCache memoizes the AWS account id behind each ec2iface.EC2API
+// client, so resolving it for the NetworkCache key doesn't cost an STS call
+// on every reconcile.
+var accountIDCache sync.Map // ec2iface.EC2API -> string
+
+// accountID resolves the AWS account id the given ec2Svc authenticates as,
+// via STS GetCallerIdentity, caching the result per client for the lifetime
+// of the process.
+func accountID(ec2Svc ec2iface.EC2API) (string, error) {
+	if cached, ok := accountIDCache.Load(ec2Svc); ok {
+		return cached.(string), nil
+	}
+
+	svc, ok := ec2Svc.(*ec2.EC2)
+	if !ok {
+		return "", nil
+	}
+
+	sess, err := session.NewSession(&svc.Config)
+	if err != nil {
+		return "", errorUtil.Wrap(err, "error building session to resolve account id")
+	}
+
+	identity, err := sts.New(sess).GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	if err != nil {
+		return "", errorUtil.Wrap(err, "error getting caller identity")
+	}
+
+	id := aws.StringValue(identity.Account)
+	accountIDCache.Store(ec2Svc, id)
+	return id, nil
+}
+
+// networkCacheKey builds the NetworkCache key for the given cluster, pulling
+// the account id and region out of the ec2 client when available.
+func networkCacheKey(clusterID string, ec2Svc ec2iface.EC2API) (NetworkCacheKey, error) {
+	acctID, err := accountID(ec2Svc)
+	if err != nil {
+		return NetworkCacheKey{}, errorUtil.Wrap(err, "error resolving account id for network cache key")
+	}
+
+	region := ""
+	if svc, ok := ec2Svc.(*ec2.EC2); ok && svc.Config.Region != nil {
+		region = *svc.Config.Region
+	}
+	return NetworkCacheKey{AccountID: acctID, Region: region, ClusterID: clusterID}, nil
+}
+
+// invalidateNetworkCache clears the cached network objects for clusterID
+// after a mutating EC2 call has already succeeded. Failing to resolve the
+// cache key is logged rather than returned, since the underlying AWS change
+// has already been made and shouldn't be undone by a cache-housekeeping error.
+func invalidateNetworkCache(clusterID string, ec2Svc ec2iface.EC2API) {
+	key, err := networkCacheKey(clusterID, ec2Svc)
+	if err != nil {
+		logrus.Warn(fmt.Sprintf("failed to resolve network cache key for invalidation: %v", err))
+		return
+	}
+	networkCache.Invalidate(key)
+}
+
+// isThrottlingError reports whether err is an EC2 RequestLimitExceeded or
+// Throttling error, which should be retried with backoff rather than failing
+// the reconcile outright.
+func isThrottlingError(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	if !ok {
+		return false
+	}
+	switch aerr.Code() {
+	case "RequestLimitExceeded", "Throttling":
+		return true
+	default:
+		return false
+	}
+}
+
+// withEC2Backoff retries fn with exponential backoff while it returns an EC2
+// throttling error, up to maxEC2RetryAttempts attempts.
+const maxEC2RetryAttempts = 5
+
+func withEC2Backoff(fn func() error) error {
+	backoff := time.Second
+	var err error
+	for attempt := 0; attempt < maxEC2RetryAttempts; attempt++ {
+		if err = fn(); err == nil || !isThrottlingError(err) {
+			return err
+		}
+		logrus.Info(fmt.Sprintf("throttled by ec2 api, backing off for %s", backoff))
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+	return err
+}
+
+// ensures a security group is in place for the creation of a resource, opening
+// only the ports required by resourceType (or the rules supplied via
+// WithSecurityGroupRules) rather than all protocols on the cluster cidr
+func SetupSecurityGroup(ctx context.Context, c client.Client, ec2Svc ec2iface.EC2API, resourceType ResourceType, opts ...CloudOption) error {
 	logrus.Info("setting resource security group")
+	cfg := buildNetworkConfig(opts...)
+
 	// get cluster id
 	clusterID, err := resources.GetClusterID(ctx, c)
 	if err != nil {
 		return errorUtil.Wrap(err, "error getting cluster id")
 	}
 
-	// build security group name
-	secName, err := BuildInfraName(ctx, c, defaultSecurityGroupPostfix, DefaultAwsIdentifierLength)
+	// get cluster cidr group
+	vpcID, cidr, err := GetCidr(ctx, c, ec2Svc, opts...)
 	if err != nil {
-		return errorUtil.Wrap(err, "error building subnet group name")
+		return errorUtil.Wrap(err, "error finding cidr block")
 	}
 
-	// get cluster cidr group
-	vpcID, cidr, err := GetCidr(ctx, c, ec2Svc)
+	rules := cfg.SecurityGroupRules
+	if len(rules) == 0 {
+		rules = defaultSecurityGroupRules[resourceType]
+	}
+	if len(rules) == 0 {
+		return errorUtil.New(fmt.Sprintf("no security group rules configured for resource type %s", resourceType))
+	}
+	desiredPermissions := buildIpPermissions(rules, cidr, cfg.ControlPlaneSecurityGroup)
+
+	// if a security group id has been supplied, reuse it instead of
+	// creating one named after the cluster
+	if cfg.SecurityGroupID != "" {
+		logrus.Info("using supplied security group id, skipping security group creation")
+		foundSecGroup, err := getSecurityGroupByID(ec2Svc, cfg.SecurityGroupID)
+		if err != nil {
+			return errorUtil.Wrap(err, "error getting security group by id")
+		}
+		if foundSecGroup == nil {
+			return errorUtil.New("error, no security group found for supplied security group id")
+		}
+		// additive-only: this group may be shared/owned by the customer, so
+		// only add the rules this resource needs, never revoke others
+		return reconcileSecurityGroupIngress(ec2Svc, clusterID, foundSecGroup, desiredPermissions, true)
+	}
+
+	// build security group name, scoped to the resource type so that
+	// e.g. postgres and redis don't share a group: reconcileSecurityGroupIngress
+	// converges a group to exactly its desired rules, so two resource types
+	// sharing one group would each revoke the rules the other one needs
+	secName, err := BuildInfraName(ctx, c, fmt.Sprintf("%s-%s", resourceType, defaultSecurityGroupPostfix), DefaultAwsIdentifierLength)
 	if err != nil {
-		return errorUtil.Wrap(err, "error finding cidr block")
+		return errorUtil.Wrap(err, "error building subnet group name")
 	}
 
-	foundSecGroup, err := getSecurityGroup(ec2Svc, secName)
+	foundSecGroup, err := getSecurityGroup(ec2Svc, clusterID, secName)
 	if err != nil {
 		return errorUtil.Wrap(err, "error get security group")
 	}
@@ -59,53 +479,153 @@ func SetupSecurityGroup(ctx context.Context, c client.Client, ec2Svc ec2iface.EC
 		}); err != nil {
 			return errorUtil.Wrap(err, "error creating security group")
 		}
+		invalidateNetworkCache(clusterID, ec2Svc)
 		return nil
 	}
 
-	// build ip permission
-	ipPermission := &ec2.IpPermission{
-		IpProtocol: aws.String("-1"),
-		IpRanges: []*ec2.IpRange{
-			{
-				CidrIp: aws.String(cidr),
-			},
-		},
+	return reconcileSecurityGroupIngress(ec2Svc, clusterID, foundSecGroup, desiredPermissions, false)
+}
+
+// buildIpPermissions converts a set of SecurityGroupRule into the
+// ec2.IpPermission shape AWS expects, filling in the cluster cidr (or the
+// control plane security group, if supplied) as the peer for any rule that
+// doesn't specify its own
+func buildIpPermissions(rules []SecurityGroupRule, clusterCidr, controlPlaneSecurityGroup string) []*ec2.IpPermission {
+	permissions := make([]*ec2.IpPermission, 0, len(rules))
+	for _, rule := range rules {
+		perm := &ec2.IpPermission{
+			IpProtocol: aws.String(strings.ToLower(rule.Protocol)),
+			FromPort:   aws.Int64(rule.FromPort),
+			ToPort:     aws.Int64(rule.ToPort),
+		}
+
+		switch {
+		case rule.SourceSecurityGroupID != "":
+			perm.UserIdGroupPairs = []*ec2.UserIdGroupPair{
+				{GroupId: aws.String(rule.SourceSecurityGroupID), Description: aws.String(rule.Description)},
+			}
+		case len(rule.CIDRBlocks) > 0:
+			for _, cidr := range rule.CIDRBlocks {
+				perm.IpRanges = append(perm.IpRanges, &ec2.IpRange{CidrIp: aws.String(cidr), Description: aws.String(rule.Description)})
+			}
+		case controlPlaneSecurityGroup != "":
+			perm.UserIdGroupPairs = []*ec2.UserIdGroupPair{
+				{GroupId: aws.String(controlPlaneSecurityGroup), Description: aws.String(rule.Description)},
+			}
+		default:
+			perm.IpRanges = []*ec2.IpRange{{CidrIp: aws.String(clusterCidr), Description: aws.String(rule.Description)}}
+		}
+
+		permissions = append(permissions, perm)
+	}
+	return permissions
+}
+
+// ipPermissionHash builds a normalized key for an ec2.IpPermission (protocol
+// lowercased, ports as-is, cidrs and peer group ids sorted) so that
+// semantically identical rules compare equal regardless of ordering
+func ipPermissionHash(perm *ec2.IpPermission) string {
+	var cidrs []string
+	for _, r := range perm.IpRanges {
+		if r.CidrIp != nil {
+			cidrs = append(cidrs, *r.CidrIp)
+		}
+	}
+	sort.Strings(cidrs)
+
+	var groupIDs []string
+	for _, g := range perm.UserIdGroupPairs {
+		if g.GroupId != nil {
+			groupIDs = append(groupIDs, *g.GroupId)
+		}
+	}
+	sort.Strings(groupIDs)
+
+	protocol := ""
+	if perm.IpProtocol != nil {
+		protocol = strings.ToLower(*perm.IpProtocol)
+	}
+	fromPort, toPort := int64(0), int64(0)
+	if perm.FromPort != nil {
+		fromPort = *perm.FromPort
+	}
+	if perm.ToPort != nil {
+		toPort = *perm.ToPort
 	}
 
-	// check if correct permissions are in place
+	return fmt.Sprintf("%s|%d|%d|%s|%s", protocol, fromPort, toPort, strings.Join(cidrs, ","), strings.Join(groupIDs, ","))
+}
+
+// reconcileSecurityGroupIngress diffs the security group's existing
+// IpPermissions against the desired rule set, authorizing missing
+// permissions and, unless additiveOnly is set, revoking stale ones so the
+// group converges to exactly the declared rules. additiveOnly must be set
+// for groups CRO does not own (bring-your-own security groups) so that
+// rules CRO doesn't recognise - e.g. a customer's own SSH/app rules - are
+// left alone instead of being stripped out.
+func reconcileSecurityGroupIngress(ec2Svc ec2iface.EC2API, clusterID string, foundSecGroup *ec2.SecurityGroup, desired []*ec2.IpPermission, additiveOnly bool) error {
+	existingByHash := make(map[string]*ec2.IpPermission, len(foundSecGroup.IpPermissions))
 	for _, perm := range foundSecGroup.IpPermissions {
-		if reflect.DeepEqual(perm, ipPermission) {
-			logrus.Info("ip permissions are correct for postgres resource")
-			return nil
+		existingByHash[ipPermissionHash(perm)] = perm
+	}
+
+	desiredByHash := make(map[string]*ec2.IpPermission, len(desired))
+	for _, perm := range desired {
+		desiredByHash[ipPermissionHash(perm)] = perm
+	}
+
+	var toRevoke []*ec2.IpPermission
+	if !additiveOnly {
+		for hash, perm := range existingByHash {
+			if _, ok := desiredByHash[hash]; !ok {
+				toRevoke = append(toRevoke, perm)
+			}
 		}
 	}
 
-	// authorize ingress
-	logrus.Info("setting ingress ip permissions")
-	if _, err := ec2Svc.AuthorizeSecurityGroupIngress(&ec2.AuthorizeSecurityGroupIngressInput{
-		GroupId: aws.String(*foundSecGroup.GroupId),
-		IpPermissions: []*ec2.IpPermission{
-			ipPermission,
-		},
-	}); err != nil {
-		return errorUtil.Wrap(err, "error authorizing security group ingress")
+	var toAuthorize []*ec2.IpPermission
+	for hash, perm := range desiredByHash {
+		if _, ok := existingByHash[hash]; !ok {
+			toAuthorize = append(toAuthorize, perm)
+		}
+	}
+
+	if len(toRevoke) > 0 {
+		logrus.Info("revoking stale ingress ip permissions")
+		if _, err := ec2Svc.RevokeSecurityGroupIngress(&ec2.RevokeSecurityGroupIngressInput{
+			GroupId:       foundSecGroup.GroupId,
+			IpPermissions: toRevoke,
+		}); err != nil {
+			return errorUtil.Wrap(err, "error revoking security group ingress")
+		}
+		invalidateNetworkCache(clusterID, ec2Svc)
+	}
+
+	if len(toAuthorize) > 0 {
+		logrus.Info("authorizing missing ingress ip permissions")
+		if _, err := ec2Svc.AuthorizeSecurityGroupIngress(&ec2.AuthorizeSecurityGroupIngressInput{
+			GroupId:       foundSecGroup.GroupId,
+			IpPermissions: toAuthorize,
+		}); err != nil {
+			return errorUtil.Wrap(err, "error authorizing security group ingress")
+		}
+		invalidateNetworkCache(clusterID, ec2Svc)
+	}
+
+	if len(toRevoke) == 0 && len(toAuthorize) == 0 {
+		logrus.Info("ip permissions are correct for resource")
 	}
 
 	return nil
 }
 
 // GetVPCSubnets returns a list of subnets associated with cluster VPC
-func GetVPCSubnets(ctx context.Context, c client.Client, ec2Svc ec2iface.EC2API) ([]*ec2.Subnet, error) {
+func GetVPCSubnets(ctx context.Context, c client.Client, ec2Svc ec2iface.EC2API, opts ...CloudOption) ([]*ec2.Subnet, error) {
 	logrus.Info("gathering cluster vpc and subnet information")
-
-	// poll subnets to ensure credentials have reconciled
-	subs, err := getSubnets(ec2Svc)
-	if err != nil {
-		return nil, errorUtil.Wrap(err, "error getting subnets")
-	}
+	cfg := buildNetworkConfig(opts...)
 
 	// get cluster vpc
-	foundVPC, err := getVpc(ctx, c, ec2Svc)
+	foundVPC, err := getVpc(ctx, c, ec2Svc, opts...)
 	if err != nil {
 		return nil, errorUtil.Wrap(err, "error getting vpcs")
 	}
@@ -115,12 +635,56 @@ func GetVPCSubnets(ctx context.Context, c client.Client, ec2Svc ec2iface.EC2API)
 		return nil, errorUtil.New("error, unable to find a vpc")
 	}
 
-	// find associated subnets
-	var associatedSubs []*ec2.Subnet
-	for _, sub := range subs {
-		if *sub.VpcId == *foundVPC.VpcId {
-			associatedSubs = append(associatedSubs, sub)
+	// if explicit subnet ids have been supplied, fetch only those instead
+	// of listing every subnet and filtering client-side
+	if len(cfg.PrivateSubnetIDs) > 0 {
+		logrus.Info("using supplied subnet ids, skipping subnet discovery")
+		subnetIDs := make([]*string, 0, len(cfg.PrivateSubnetIDs))
+		for i := range cfg.PrivateSubnetIDs {
+			subnetIDs = append(subnetIDs, aws.String(cfg.PrivateSubnetIDs[i]))
 		}
+		out, err := ec2Svc.DescribeSubnets(&ec2.DescribeSubnetsInput{
+			Filters: []*ec2.Filter{
+				{
+					Name:   aws.String("vpc-id"),
+					Values: []*string{foundVPC.VpcId},
+				},
+			},
+			SubnetIds: subnetIDs,
+		})
+		if err != nil {
+			return nil, errorUtil.Wrap(err, "error describing supplied subnets")
+		}
+		if len(out.Subnets) == 0 {
+			return nil, errorUtil.New("error, unable to find subnets for supplied subnet ids")
+		}
+		return out.Subnets, nil
+	}
+
+	clusterID, err := resources.GetClusterID(ctx, c)
+	if err != nil {
+		return nil, errorUtil.Wrap(err, "error getting clusterID")
+	}
+
+	cacheKey, err := networkCacheKey(clusterID, ec2Svc)
+	if err != nil {
+		return nil, errorUtil.Wrap(err, "error building network cache key")
+	}
+	if cached := networkCache.GetSubnets(cacheKey); cached != nil {
+		logrus.Info("using cached vpc subnets")
+		return cached, nil
+	}
+
+	// fetch only the subnets belonging to the cluster vpc, server-side,
+	// rather than listing every subnet in the account and filtering client-side
+	associatedSubs, err := getSubnets(ec2Svc, []*ec2.Filter{
+		{
+			Name:   aws.String("vpc-id"),
+			Values: []*string{foundVPC.VpcId},
+		},
+	})
+	if err != nil {
+		return nil, errorUtil.Wrap(err, "error getting subnets")
 	}
 
 	// check if found subnets associated with cluster vpc
@@ -128,6 +692,7 @@ func GetVPCSubnets(ctx context.Context, c client.Client, ec2Svc ec2iface.EC2API)
 		return nil, errorUtil.New("error, unable to find subnets associated with cluster vpc")
 	}
 
+	networkCache.SetSubnets(cacheKey, associatedSubs)
 	return associatedSubs, nil
 }
 
@@ -153,45 +718,118 @@ func GetAllSubnetIDS(ctx context.Context, c client.Client, ec2Svc ec2iface.EC2AP
 }
 
 // GetSubnetIDS returns a list of subnet ids associated with cluster vpc
-func GetPrivateSubnetIDS(ctx context.Context, c client.Client, ec2Svc ec2iface.EC2API) ([]*string, error) {
+func GetPrivateSubnetIDS(ctx context.Context, c client.Client, ec2Svc ec2iface.EC2API, opts ...CloudOption) ([]*string, error) {
 	logrus.Info("gathering private vpc subnets")
-	subs, err := GetVPCSubnets(ctx, c, ec2Svc)
+	privateSubs, err := getPrivateSubnets(ctx, c, ec2Svc, opts...)
 	if err != nil {
-		return nil, errorUtil.Wrap(err, "error getting vpc subnets")
+		return nil, err
 	}
 
-	regexpStr := "\\b(\\w*private\\w*)\\b"
-	anReg, err := regexp.Compile(regexpStr)
+	// build list of subnet ids
+	var subIDs []*string
+	for _, sub := range privateSubs {
+		subIDs = append(subIDs, sub.SubnetId)
+	}
+
+	if subIDs == nil {
+		return nil, errorUtil.New("failed to get list of private subnet ids")
+	}
+
+	return subIDs, nil
+}
+
+// GetPrivateSubnetIDSByAZ returns at most one private subnet id per
+// availability zone, so RDS DBSubnetGroup creation gets a properly balanced
+// Multi-AZ layout instead of every tagged private subnet regardless of zone.
+// It errors out if fewer than minAZs distinct availability zones are found.
+func GetPrivateSubnetIDSByAZ(ctx context.Context, c client.Client, ec2Svc ec2iface.EC2API, minAZs int, opts ...CloudOption) ([]*string, error) {
+	logrus.Info("gathering private vpc subnets balanced across availability zones")
+	privateSubs, err := getPrivateSubnets(ctx, c, ec2Svc, opts...)
 	if err != nil {
-		return nil, errorUtil.Wrapf(err, "failed to compile regexp %s", regexpStr)
+		return nil, err
 	}
 
-	var privateSubs []*ec2.Subnet
+	return selectSubnetsByAZ(privateSubs, minAZs)
+}
+
+// selectSubnetsByAZ groups subnets by availability zone, keeping the lowest
+// subnet id per zone so the selection is deterministic across reconciles,
+// and errors out if fewer than minAZs distinct zones are found.
+func selectSubnetsByAZ(subs []*ec2.Subnet, minAZs int) ([]*string, error) {
+	byAZ := make(map[string]*ec2.Subnet)
 	for _, sub := range subs {
-		for _, tags := range sub.Tags {
-			if anReg.MatchString(*tags.Value) {
-				privateSubs = append(privateSubs, sub)
-			}
+		if sub.AvailabilityZone == nil || sub.SubnetId == nil {
+			continue
+		}
+		az := *sub.AvailabilityZone
+		existing, ok := byAZ[az]
+		if !ok || *sub.SubnetId < *existing.SubnetId {
+			byAZ[az] = sub
 		}
 	}
 
-	// build list of subnet ids
-	var subIDs []*string
-	for _, sub := range privateSubs {
-		subIDs = append(subIDs, sub.SubnetId)
+	if len(byAZ) < minAZs {
+		return nil, errorUtil.New(fmt.Sprintf("found %d availability zones with private subnets, expected at least %d", len(byAZ), minAZs))
 	}
 
-	if subIDs == nil {
-		return nil, errorUtil.New("failed to get list of private subnet ids")
+	azs := make([]string, 0, len(byAZ))
+	for az := range byAZ {
+		azs = append(azs, az)
+	}
+	sort.Strings(azs)
+
+	subIDs := make([]*string, 0, len(azs))
+	for _, az := range azs {
+		subIDs = append(subIDs, byAZ[az].SubnetId)
 	}
 
 	return subIDs, nil
 }
 
+// getPrivateSubnets returns the subnets in the cluster vpc tagged as private,
+// per the PrivateSubnetTagKey/PrivateSubnetTagValue regex configured in the
+// DiscoveryConfig
+func getPrivateSubnets(ctx context.Context, c client.Client, ec2Svc ec2iface.EC2API, opts ...CloudOption) ([]*ec2.Subnet, error) {
+	subs, err := GetVPCSubnets(ctx, c, ec2Svc, opts...)
+	if err != nil {
+		return nil, errorUtil.Wrap(err, "error getting vpc subnets")
+	}
+
+	clusterID, err := resources.GetClusterID(ctx, c)
+	if err != nil {
+		return nil, errorUtil.Wrap(err, "error getting clusterID")
+	}
+
+	discoveryCfg, err := loadDiscoveryConfig(ctx, c, clusterID)
+	if err != nil {
+		return nil, errorUtil.Wrap(err, "error loading discovery config")
+	}
+
+	anReg, err := regexp.Compile(discoveryCfg.PrivateSubnetTagValue)
+	if err != nil {
+		return nil, errorUtil.Wrapf(err, "failed to compile regexp %s", discoveryCfg.PrivateSubnetTagValue)
+	}
+
+	var privateSubs []*ec2.Subnet
+	for _, sub := range subs {
+		for _, tag := range sub.Tags {
+			if discoveryCfg.PrivateSubnetTagKey != "" && (tag.Key == nil || *tag.Key != discoveryCfg.PrivateSubnetTagKey) {
+				continue
+			}
+			if anReg.MatchString(*tag.Value) {
+				privateSubs = append(privateSubs, sub)
+				break
+			}
+		}
+	}
+
+	return privateSubs, nil
+}
+
 // returns vpc id and cidr block for found vpc
-func GetCidr(ctx context.Context, c client.Client, ec2Svc ec2iface.EC2API) (string, string, error) {
+func GetCidr(ctx context.Context, c client.Client, ec2Svc ec2iface.EC2API, opts ...CloudOption) (string, string, error) {
 	logrus.Info("gathering cidr block for cluster")
-	foundVPC, err := getVpc(ctx, c, ec2Svc)
+	foundVPC, err := getVpc(ctx, c, ec2Svc, opts...)
 	if err != nil {
 		return "", "", errorUtil.Wrap(err, "error getting vpcs")
 	}
@@ -204,16 +842,16 @@ func GetCidr(ctx context.Context, c client.Client, ec2Svc ec2iface.EC2API) (stri
 	return *foundVPC.VpcId, *foundVPC.CidrBlock, nil
 }
 
-// function to get subnets, used to check/wait on AWS credentials
-func getSubnets(ec2Svc ec2iface.EC2API) ([]*ec2.Subnet, error) {
+// getSubnets pages through DescribeSubnets for the given filters, retrying
+// with exponential backoff if EC2 throttles the request
+func getSubnets(ec2Svc ec2iface.EC2API, filters []*ec2.Filter) ([]*ec2.Subnet, error) {
 	var subs []*ec2.Subnet
-	err := wait.PollImmediate(time.Second*5, time.Minute*5, func() (done bool, err error) {
-		listOutput, err := ec2Svc.DescribeSubnets(&ec2.DescribeSubnetsInput{})
-		if err != nil {
-			return false, nil
-		}
-		subs = listOutput.Subnets
-		return true, nil
+	err := withEC2Backoff(func() error {
+		subs = nil
+		return ec2Svc.DescribeSubnetsPages(&ec2.DescribeSubnetsInput{Filters: filters}, func(page *ec2.DescribeSubnetsOutput, lastPage bool) bool {
+			subs = append(subs, page.Subnets...)
+			return true
+		})
 	})
 	if err != nil {
 		return nil, err
@@ -222,12 +860,33 @@ func getSubnets(ec2Svc ec2iface.EC2API) ([]*ec2.Subnet, error) {
 }
 
 // function to get vpc of a cluster
-func getVpc(ctx context.Context, c client.Client, ec2Svc ec2iface.EC2API) (*ec2.Vpc, error) {
-	logrus.Info("finding cluster vpc")
-	// get vpcs
-	vpcs, err := ec2Svc.DescribeVpcs(&ec2.DescribeVpcsInput{})
-	if err != nil {
-		return nil, errorUtil.Wrap(err, "error getting subnets")
+func getVpc(ctx context.Context, c client.Client, ec2Svc ec2iface.EC2API, opts ...CloudOption) (*ec2.Vpc, error) {
+	cfg := buildNetworkConfig(opts...)
+
+	// if a vpc id has been supplied, fetch it directly instead of
+	// scanning every vpc for the cluster tag
+	if cfg.VPCID != "" {
+		logrus.Info("using supplied vpc id, skipping cluster tag lookup")
+		var out *ec2.DescribeVpcsOutput
+		err := withEC2Backoff(func() error {
+			var apiErr error
+			out, apiErr = ec2Svc.DescribeVpcs(&ec2.DescribeVpcsInput{
+				Filters: []*ec2.Filter{
+					{
+						Name:   aws.String("vpc-id"),
+						Values: []*string{aws.String(cfg.VPCID)},
+					},
+				},
+			})
+			return apiErr
+		})
+		if err != nil {
+			return nil, errorUtil.Wrap(err, "error getting vpc by id")
+		}
+		if len(out.Vpcs) == 0 {
+			return nil, errorUtil.New("error, no vpc found for supplied vpc id")
+		}
+		return out.Vpcs[0], nil
 	}
 
 	// get cluster id
@@ -236,12 +895,60 @@ func getVpc(ctx context.Context, c client.Client, ec2Svc ec2iface.EC2API) (*ec2.
 		return nil, errorUtil.Wrap(err, "error getting clusterID")
 	}
 
-	// find associated vpc to cluster
+	cacheKey, err := networkCacheKey(clusterID, ec2Svc)
+	if err != nil {
+		return nil, errorUtil.Wrap(err, "error building network cache key")
+	}
+	if cached := networkCache.GetVPC(cacheKey); cached != nil {
+		logrus.Info("using cached cluster vpc")
+		return cached, nil
+	}
+
+	logrus.Info("finding cluster vpc")
+	discoveryCfg, err := loadDiscoveryConfig(ctx, c, clusterID)
+	if err != nil {
+		return nil, errorUtil.Wrap(err, "error loading discovery config")
+	}
+
+	var input *ec2.DescribeVpcsInput
+	if discoveryCfg.VPCTagKey != "" {
+		// the tag key is known, so find the vpc tagged for the cluster
+		// server-side rather than fetching every vpc and filtering client-side
+		input = &ec2.DescribeVpcsInput{
+			Filters: []*ec2.Filter{
+				{
+					Name:   aws.String(fmt.Sprintf("tag:%s", discoveryCfg.VPCTagKey)),
+					Values: []*string{aws.String(discoveryCfg.VPCTagValue)},
+				},
+			},
+		}
+	} else {
+		// no tag key configured: match the value under any tag key, as the
+		// original cluster-tag lookup did
+		input = &ec2.DescribeVpcsInput{}
+	}
+
+	var vpcs *ec2.DescribeVpcsOutput
+	err = withEC2Backoff(func() error {
+		var apiErr error
+		vpcs, apiErr = ec2Svc.DescribeVpcs(input)
+		return apiErr
+	})
+	if err != nil {
+		return nil, errorUtil.Wrap(err, "error getting vpcs")
+	}
+
 	var foundVPC *ec2.Vpc
-	for _, vpc := range vpcs.Vpcs {
-		for _, tag := range vpc.Tags {
-			if *tag.Value == fmt.Sprintf("%s-vpc", clusterID) {
-				foundVPC = vpc
+	if discoveryCfg.VPCTagKey != "" {
+		if len(vpcs.Vpcs) > 0 {
+			foundVPC = vpcs.Vpcs[0]
+		}
+	} else {
+		for _, vpc := range vpcs.Vpcs {
+			for _, tag := range vpc.Tags {
+				if tag.Value != nil && *tag.Value == discoveryCfg.VPCTagValue {
+					foundVPC = vpc
+				}
 			}
 		}
 	}
@@ -250,19 +957,28 @@ func getVpc(ctx context.Context, c client.Client, ec2Svc ec2iface.EC2API) (*ec2.
 		return nil, errorUtil.New("error, no vpc found")
 	}
 
+	networkCache.SetVPC(cacheKey, foundVPC)
 	return foundVPC, nil
 }
 
-func getSecurityGroup(ec2Svc ec2iface.EC2API, secName string) (*ec2.SecurityGroup, error) {
-	// get security groups
-	secGroups, err := ec2Svc.DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{})
+func getSecurityGroup(ec2Svc ec2iface.EC2API, clusterID, secName string) (*ec2.SecurityGroup, error) {
+	cacheKey, err := networkCacheKey(clusterID, ec2Svc)
 	if err != nil {
-		return nil, errorUtil.Wrap(err, "failed to return information about security groups")
+		return nil, errorUtil.Wrap(err, "error building network cache key")
+	}
+	secGroups := networkCache.GetSecurityGroups(cacheKey)
+	if secGroups == nil {
+		var err error
+		secGroups, err = describeAllSecurityGroups(ec2Svc)
+		if err != nil {
+			return nil, err
+		}
+		networkCache.SetSecurityGroups(cacheKey, secGroups)
 	}
 
 	// check if security group exists
 	var foundSecGroup *ec2.SecurityGroup
-	for _, sec := range secGroups.SecurityGroups {
+	for _, sec := range secGroups {
 		if *sec.GroupName == secName {
 			foundSecGroup = sec
 			break
@@ -271,3 +987,46 @@ func getSecurityGroup(ec2Svc ec2iface.EC2API, secName string) (*ec2.SecurityGrou
 
 	return foundSecGroup, nil
 }
+
+// getSecurityGroupByID fetches a security group directly by its id via a
+// server-side group-id filter, for use when a security group id has been
+// supplied instead of a cluster-derived name
+func getSecurityGroupByID(ec2Svc ec2iface.EC2API, groupID string) (*ec2.SecurityGroup, error) {
+	var secGroups *ec2.DescribeSecurityGroupsOutput
+	err := withEC2Backoff(func() error {
+		var apiErr error
+		secGroups, apiErr = ec2Svc.DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{
+			Filters: []*ec2.Filter{
+				{
+					Name:   aws.String("group-id"),
+					Values: []*string{aws.String(groupID)},
+				},
+			},
+		})
+		return apiErr
+	})
+	if err != nil {
+		return nil, errorUtil.Wrap(err, "failed to return information about security groups")
+	}
+
+	if len(secGroups.SecurityGroups) == 0 {
+		return nil, nil
+	}
+
+	return secGroups.SecurityGroups[0], nil
+}
+
+// describeAllSecurityGroups lists every security group visible to the
+// credentials in use, retrying with backoff if EC2 throttles the request
+func describeAllSecurityGroups(ec2Svc ec2iface.EC2API) ([]*ec2.SecurityGroup, error) {
+	var out *ec2.DescribeSecurityGroupsOutput
+	err := withEC2Backoff(func() error {
+		var apiErr error
+		out, apiErr = ec2Svc.DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{})
+		return apiErr
+	})
+	if err != nil {
+		return nil, errorUtil.Wrap(err, "failed to return information about security groups")
+	}
+	return out.SecurityGroups, nil
+}
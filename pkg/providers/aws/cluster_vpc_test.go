@@ -0,0 +1,235 @@
+package aws
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+)
+
+func subnet(id, az string) *ec2.Subnet {
+	return &ec2.Subnet{
+		SubnetId:         aws.String(id),
+		AvailabilityZone: aws.String(az),
+	}
+}
+
+func TestSelectSubnetsByAZ(t *testing.T) {
+	cases := []struct {
+		name    string
+		subs    []*ec2.Subnet
+		minAZs  int
+		wantIDs []string
+		wantErr bool
+	}{
+		{
+			name: "one subnet per az is kept as-is",
+			subs: []*ec2.Subnet{
+				subnet("subnet-b", "eu-west-1b"),
+				subnet("subnet-a", "eu-west-1a"),
+			},
+			minAZs:  2,
+			wantIDs: []string{"subnet-a", "subnet-b"},
+		},
+		{
+			name: "lowest subnet id wins when an az has multiple subnets",
+			subs: []*ec2.Subnet{
+				subnet("subnet-a2", "eu-west-1a"),
+				subnet("subnet-a1", "eu-west-1a"),
+				subnet("subnet-b1", "eu-west-1b"),
+			},
+			minAZs:  2,
+			wantIDs: []string{"subnet-a1", "subnet-b1"},
+		},
+		{
+			name: "fewer azs than required errors",
+			subs: []*ec2.Subnet{
+				subnet("subnet-a", "eu-west-1a"),
+			},
+			minAZs:  2,
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := selectSubnetsByAZ(tc.subs, tc.minAZs)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(got) != len(tc.wantIDs) {
+				t.Fatalf("expected %d subnet ids, got %d (%v)", len(tc.wantIDs), len(got), got)
+			}
+			for i, id := range tc.wantIDs {
+				if *got[i] != id {
+					t.Errorf("expected subnet id %s at index %d, got %s", id, i, *got[i])
+				}
+			}
+		})
+	}
+}
+
+func TestIpPermissionHash(t *testing.T) {
+	a := &ec2.IpPermission{
+		IpProtocol: aws.String("TCP"),
+		FromPort:   aws.Int64(5432),
+		ToPort:     aws.Int64(5432),
+		IpRanges: []*ec2.IpRange{
+			{CidrIp: aws.String("10.0.2.0/24")},
+			{CidrIp: aws.String("10.0.1.0/24")},
+		},
+	}
+	b := &ec2.IpPermission{
+		IpProtocol: aws.String("tcp"),
+		FromPort:   aws.Int64(5432),
+		ToPort:     aws.Int64(5432),
+		IpRanges: []*ec2.IpRange{
+			{CidrIp: aws.String("10.0.1.0/24")},
+			{CidrIp: aws.String("10.0.2.0/24")},
+		},
+	}
+	if ipPermissionHash(a) != ipPermissionHash(b) {
+		t.Errorf("expected equivalent permissions with different protocol case / cidr order to hash equal, got %q and %q", ipPermissionHash(a), ipPermissionHash(b))
+	}
+
+	c := &ec2.IpPermission{
+		IpProtocol: aws.String("tcp"),
+		FromPort:   aws.Int64(6379),
+		ToPort:     aws.Int64(6379),
+		IpRanges:   []*ec2.IpRange{{CidrIp: aws.String("10.0.1.0/24")}},
+	}
+	if ipPermissionHash(a) == ipPermissionHash(c) {
+		t.Errorf("expected permissions on different ports to hash differently")
+	}
+}
+
+// mockEC2Client records AuthorizeSecurityGroupIngress/RevokeSecurityGroupIngress
+// calls; all other ec2iface.EC2API methods are unimplemented.
+type mockEC2Client struct {
+	ec2iface.EC2API
+	authorizeCalls []*ec2.AuthorizeSecurityGroupIngressInput
+	revokeCalls    []*ec2.RevokeSecurityGroupIngressInput
+}
+
+func (m *mockEC2Client) AuthorizeSecurityGroupIngress(in *ec2.AuthorizeSecurityGroupIngressInput) (*ec2.AuthorizeSecurityGroupIngressOutput, error) {
+	m.authorizeCalls = append(m.authorizeCalls, in)
+	return &ec2.AuthorizeSecurityGroupIngressOutput{}, nil
+}
+
+func (m *mockEC2Client) RevokeSecurityGroupIngress(in *ec2.RevokeSecurityGroupIngressInput) (*ec2.RevokeSecurityGroupIngressOutput, error) {
+	m.revokeCalls = append(m.revokeCalls, in)
+	return &ec2.RevokeSecurityGroupIngressOutput{}, nil
+}
+
+func TestReconcileSecurityGroupIngress(t *testing.T) {
+	postgres := &ec2.IpPermission{
+		IpProtocol: aws.String("tcp"),
+		FromPort:   aws.Int64(5432),
+		ToPort:     aws.Int64(5432),
+		IpRanges:   []*ec2.IpRange{{CidrIp: aws.String("10.0.0.0/16")}},
+	}
+	redis := &ec2.IpPermission{
+		IpProtocol: aws.String("tcp"),
+		FromPort:   aws.Int64(6379),
+		ToPort:     aws.Int64(6379),
+		IpRanges:   []*ec2.IpRange{{CidrIp: aws.String("10.0.0.0/16")}},
+	}
+	group := &ec2.SecurityGroup{
+		GroupId:       aws.String("sg-123"),
+		IpPermissions: []*ec2.IpPermission{postgres},
+	}
+
+	t.Run("converging reconcile revokes rules not in desired", func(t *testing.T) {
+		m := &mockEC2Client{}
+		if err := reconcileSecurityGroupIngress(m, "cluster1", group, []*ec2.IpPermission{redis}, false); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(m.revokeCalls) != 1 {
+			t.Fatalf("expected 1 revoke call, got %d", len(m.revokeCalls))
+		}
+		if len(m.authorizeCalls) != 1 {
+			t.Fatalf("expected 1 authorize call, got %d", len(m.authorizeCalls))
+		}
+	})
+
+	t.Run("additive-only reconcile never revokes", func(t *testing.T) {
+		m := &mockEC2Client{}
+		if err := reconcileSecurityGroupIngress(m, "cluster1", group, []*ec2.IpPermission{redis}, true); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(m.revokeCalls) != 0 {
+			t.Fatalf("expected no revoke calls for an additive-only (bring-your-own) security group, got %d", len(m.revokeCalls))
+		}
+		if len(m.authorizeCalls) != 1 {
+			t.Fatalf("expected 1 authorize call, got %d", len(m.authorizeCalls))
+		}
+	})
+}
+
+func TestNetworkCacheTTLExpiry(t *testing.T) {
+	nc := NewNetworkCache(time.Millisecond)
+	key := NetworkCacheKey{AccountID: "1234", Region: "eu-west-1", ClusterID: "cluster1"}
+	vpc := &ec2.Vpc{VpcId: aws.String("vpc-123")}
+
+	nc.SetVPC(key, vpc)
+	if got := nc.GetVPC(key); got != vpc {
+		t.Fatalf("expected freshly set vpc to be returned, got %v", got)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	if got := nc.GetVPC(key); got != nil {
+		t.Fatalf("expected expired entry to return nil, got %v", got)
+	}
+}
+
+func TestNetworkCacheInvalidate(t *testing.T) {
+	nc := NewNetworkCache(time.Minute)
+	key := NetworkCacheKey{AccountID: "1234", Region: "eu-west-1", ClusterID: "cluster1"}
+	nc.SetSubnets(key, []*ec2.Subnet{subnet("subnet-a", "eu-west-1a")})
+
+	if got := nc.GetSubnets(key); got == nil {
+		t.Fatalf("expected set subnets to be cached")
+	}
+
+	nc.Invalidate(key)
+	if got := nc.GetSubnets(key); got != nil {
+		t.Fatalf("expected invalidated entry to return nil, got %v", got)
+	}
+}
+
+// TestNetworkCacheConcurrentAccess exercises concurrent Get/Set calls against
+// a shared key, as happens when multiple CR kinds reconcile the same cluster
+// at once. Run with -race to catch any regression of the NetworkCache
+// locking that guards entry field access.
+func TestNetworkCacheConcurrentAccess(t *testing.T) {
+	nc := NewNetworkCache(time.Minute)
+	key := NetworkCacheKey{AccountID: "1234", Region: "eu-west-1", ClusterID: "cluster1"}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(3)
+		go func(i int) {
+			defer wg.Done()
+			nc.SetVPC(key, &ec2.Vpc{VpcId: aws.String("vpc-123")})
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			nc.SetSubnets(key, []*ec2.Subnet{subnet("subnet-a", "eu-west-1a")})
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			_ = nc.GetVPC(key)
+			_ = nc.GetSubnets(key)
+		}(i)
+	}
+	wg.Wait()
+}